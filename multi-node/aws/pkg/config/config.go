@@ -0,0 +1,775 @@
+// Package config parses and validates the cluster.yaml configuration that
+// drives kube-aws, and derives the values (service/DNS IPs, subnet layout,
+// etc.) that the stack template and cloud-config rendering stages consume.
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	defaultInstanceCIDR     = "10.0.0.0/24"
+	defaultControllerIP     = "10.0.0.50"
+	defaultVPCCIDR          = "10.0.0.0/16"
+	defaultPodCIDR          = "10.2.0.0/16"
+	defaultServiceCIDR      = "10.3.0.0/24"
+	defaultReleaseChannel   = "alpha"
+	defaultRecordSetTTL     = 300
+	defaultServiceDNSDomain = "cluster.local"
+)
+
+var supportedReleaseChannels = map[string]bool{
+	"alpha": true,
+	"beta":  true,
+	// "stable" is intentionally not supported yet.
+}
+
+// Zone types a subnet can be launched into. AWS Local Zones and Wavelength
+// Zones are edge extensions of a region that, unlike a regular
+// availability-zone, cannot host a control plane.
+const (
+	ZoneTypeAvailabilityZone = "availability-zone"
+	ZoneTypeLocalZone        = "local-zone"
+	ZoneTypeWavelengthZone   = "wavelength-zone"
+)
+
+var supportedZoneTypes = map[string]bool{
+	ZoneTypeAvailabilityZone: true,
+	ZoneTypeLocalZone:        true,
+	ZoneTypeWavelengthZone:   true,
+}
+
+// Subnet describes a single subnet that instances are launched into, either
+// one created by kube-aws from an availabilityZone/instanceCIDR pair, or one
+// the user has already provisioned outside of kube-aws (identified by
+// SubnetID instead of InstanceCIDR).
+type Subnet struct {
+	AvailabilityZone string `yaml:"availabilityZone,omitempty"`
+	InstanceCIDR     string `yaml:"instanceCIDR,omitempty"`
+
+	// SubnetID imports an already-provisioned subnet instead of having
+	// kube-aws create one from InstanceCIDR. Only valid alongside a
+	// top-level vpcId.
+	SubnetID string `yaml:"subnetId,omitempty"`
+	// SubnetLogicalName is the CloudFormation logical name used to
+	// reference an imported subnet. It is kept exactly as given; no default
+	// is filled in when it is left blank.
+	SubnetLogicalName string `yaml:"subnetLogicalName,omitempty"`
+
+	// ZoneType is one of ZoneTypeAvailabilityZone (the default),
+	// ZoneTypeLocalZone or ZoneTypeWavelengthZone.
+	ZoneType string `yaml:"zoneType,omitempty"`
+	// ParentZone is the regular availability zone a Local Zone or
+	// Wavelength Zone is anchored to. Required when ZoneType is an edge
+	// zone type, ignored otherwise.
+	ParentZone string `yaml:"parentZone,omitempty"`
+}
+
+// Imported reports whether the subnet refers to a pre-existing AWS subnet
+// (via SubnetID) rather than one kube-aws creates from InstanceCIDR.
+func (s Subnet) Imported() bool {
+	return s.SubnetID != ""
+}
+
+// Edge reports whether the subnet is in an AWS Local Zone or Wavelength
+// Zone rather than a regular availability zone.
+func (s Subnet) Edge() bool {
+	return s.ZoneType == ZoneTypeLocalZone || s.ZoneType == ZoneTypeWavelengthZone
+}
+
+// RequiresCarrierGateway reports whether routing for the subnet must go
+// through an AWS::EC2::CarrierGateway instead of an internet/NAT gateway,
+// which is the case for every Wavelength Zone subnet.
+func (s Subnet) RequiresCarrierGateway() bool {
+	return s.ZoneType == ZoneTypeWavelengthZone
+}
+
+// clusterYAML mirrors Cluster but uses pointer types for fields where the
+// zero value is a legal, explicitly-set value, so that ClusterFromBytes can
+// tell "not present in the YAML" apart from "present and set to zero".
+type clusterYAML struct {
+	ExternalDNSName string `yaml:"externalDNSName"`
+	KeyName         string `yaml:"keyName"`
+	Region          string `yaml:"region"`
+	ClusterName     string `yaml:"clusterName"`
+	KMSKeyARN       string `yaml:"kmsKeyArn"`
+
+	AvailabilityZone string `yaml:"availabilityZone,omitempty"`
+
+	VPCID        string `yaml:"vpcId,omitempty"`
+	RouteTableID string `yaml:"routeTableId,omitempty"`
+
+	VPCCIDR             string `yaml:"vpcCIDR,omitempty"`
+	InstanceCIDR        string `yaml:"instanceCIDR,omitempty"`
+	ControllerIP        string `yaml:"controllerIP,omitempty"`
+	PodCIDR             string `yaml:"podCIDR,omitempty"`
+	ServiceCIDR         string `yaml:"serviceCIDR,omitempty"`
+	DNSServiceIP        string `yaml:"dnsServiceIP,omitempty"`
+	KubernetesServiceIP string `yaml:"kubernetesServiceIP,omitempty"`
+	ServiceDNSDomain    string `yaml:"serviceDNSDomain,omitempty"`
+
+	// AdditionalNetworkCIDRs lists CIDRs that are reachable from the cluster
+	// but not managed by it (on-prem ranges reachable via VPN/DX, peered
+	// VPCs, etc). vpcCIDR, podCIDR and serviceCIDR must not overlap with any
+	// of them.
+	AdditionalNetworkCIDRs []string `yaml:"additionalNetworkCIDRs,omitempty"`
+
+	CreateRecordSet bool   `yaml:"createRecordSet,omitempty"`
+	RecordSetTTL    *int   `yaml:"recordSetTTL,omitempty"`
+	HostedZone      string `yaml:"hostedZone,omitempty"`
+
+	DNSProviderName     string `yaml:"dnsProvider,omitempty"`
+	HostedZoneName      string `yaml:"hostedZoneName,omitempty"`
+	HostedZoneDNSSuffix string `yaml:"hostedZoneDNSSuffix,omitempty"`
+
+	ReleaseChannel string `yaml:"releaseChannel,omitempty"`
+
+	Subnets []Subnet `yaml:"subnets"`
+}
+
+// Cluster is the fully parsed and defaulted representation of cluster.yaml.
+type Cluster struct {
+	ExternalDNSName string
+	KeyName         string
+	Region          string
+	ClusterName     string
+	KMSKeyARN       string
+
+	AvailabilityZone string
+
+	VPCID        string
+	RouteTableID string
+
+	VPCCIDR             string
+	InstanceCIDR        string
+	ControllerIP        string
+	PodCIDR             string
+	ServiceCIDR         string
+	DNSServiceIP        string
+	KubernetesServiceIP string
+	ServiceDNSDomain    string
+
+	AdditionalNetworkCIDRs []string
+
+	CreateRecordSet bool
+	RecordSetTTL    int
+	HostedZone      string
+
+	DNSProviderName     string
+	HostedZoneName      string
+	HostedZoneDNSSuffix string
+	dnsProvider         DNSProvider
+
+	ReleaseChannel string
+
+	Subnets []Subnet
+}
+
+// DNSProvider returns the DNSProvider selected by dnsProvider (route53 by
+// default), fully resolved against hostedZone/hostedZoneName/
+// hostedZoneDNSSuffix.
+func (c *Cluster) DNSProvider() DNSProvider {
+	return c.dnsProvider
+}
+
+// ClusterFromBytes parses the given cluster.yaml contents, applies defaults
+// for anything left unset, and validates the result.
+func ClusterFromBytes(data []byte) (*Cluster, error) {
+	raw := clusterYAML{
+		Subnets: nil,
+	}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse cluster config: %v", err)
+	}
+
+	c := &Cluster{
+		ExternalDNSName: raw.ExternalDNSName,
+		KeyName:         raw.KeyName,
+		Region:          raw.Region,
+		ClusterName:     raw.ClusterName,
+		KMSKeyARN:       raw.KMSKeyARN,
+
+		AvailabilityZone: raw.AvailabilityZone,
+
+		VPCID:        raw.VPCID,
+		RouteTableID: raw.RouteTableID,
+
+		VPCCIDR:             raw.VPCCIDR,
+		InstanceCIDR:        raw.InstanceCIDR,
+		ControllerIP:        raw.ControllerIP,
+		PodCIDR:             raw.PodCIDR,
+		ServiceCIDR:         raw.ServiceCIDR,
+		DNSServiceIP:        raw.DNSServiceIP,
+		KubernetesServiceIP: raw.KubernetesServiceIP,
+		ServiceDNSDomain:    raw.ServiceDNSDomain,
+
+		AdditionalNetworkCIDRs: raw.AdditionalNetworkCIDRs,
+
+		CreateRecordSet: raw.CreateRecordSet,
+		HostedZone:      raw.HostedZone,
+
+		DNSProviderName:     raw.DNSProviderName,
+		HostedZoneName:      raw.HostedZoneName,
+		HostedZoneDNSSuffix: raw.HostedZoneDNSSuffix,
+
+		ReleaseChannel: raw.ReleaseChannel,
+
+		Subnets: raw.Subnets,
+	}
+
+	ttlModified := raw.RecordSetTTL != nil
+	if ttlModified {
+		c.RecordSetTTL = *raw.RecordSetTTL
+	} else {
+		c.RecordSetTTL = defaultRecordSetTTL
+	}
+
+	if c.VPCCIDR == "" {
+		c.VPCCIDR = defaultVPCCIDR
+	}
+	if c.PodCIDR == "" {
+		c.PodCIDR = defaultPodCIDR
+	}
+	if c.ServiceCIDR == "" {
+		c.ServiceCIDR = defaultServiceCIDR
+	}
+	if c.ReleaseChannel == "" {
+		c.ReleaseChannel = defaultReleaseChannel
+	}
+	if c.ServiceDNSDomain == "" {
+		c.ServiceDNSDomain = defaultServiceDNSDomain
+	}
+
+	if c.DNSProviderName == "" {
+		c.DNSProviderName = defaultDNSProvider
+	}
+	if c.HostedZoneName == "" {
+		c.HostedZoneName = c.HostedZone
+	}
+	if c.HostedZoneDNSSuffix == "" {
+		c.HostedZoneDNSSuffix = c.HostedZoneName
+	}
+	dnsProvider, err := newDNSProvider(c.DNSProviderName, c.HostedZoneName, c.HostedZoneDNSSuffix)
+	if err != nil {
+		return nil, err
+	}
+	c.dnsProvider = dnsProvider
+
+	if err := c.validateSubnets(raw); err != nil {
+		return nil, err
+	}
+
+	if err := c.validateReleaseChannel(); err != nil {
+		return nil, err
+	}
+
+	if err := c.validateNetworking(); err != nil {
+		return nil, err
+	}
+
+	if err := c.validateDNS(ttlModified); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Cluster) validateReleaseChannel() error {
+	if !supportedReleaseChannels[c.ReleaseChannel] {
+		return fmt.Errorf("releaseChannel %q is not supported", c.ReleaseChannel)
+	}
+	return nil
+}
+
+// validateSubnets normalizes c.Subnets from either the top-level
+// availabilityZone/instanceCIDR pair or an explicit `subnets:` list, and
+// rejects configurations that mix the two or omit required fields.
+func (c *Cluster) validateSubnets(raw clusterYAML) error {
+	if len(raw.Subnets) > 0 {
+		if raw.AvailabilityZone != "" || raw.InstanceCIDR != "" {
+			return fmt.Errorf("availabilityZone/instanceCIDR must not be specified when subnets are")
+		}
+
+		subnets := make([]Subnet, 0, len(raw.Subnets))
+		for _, s := range raw.Subnets {
+			if s.AvailabilityZone == "" {
+				return fmt.Errorf("availabilityZone must be specified for every subnet")
+			}
+			if s.Imported() {
+				if s.InstanceCIDR != "" {
+					return fmt.Errorf("subnet %q specifies both subnetId and instanceCIDR; an imported subnet's CIDR is managed outside kube-aws", s.SubnetID)
+				}
+			} else if s.InstanceCIDR == "" {
+				s.InstanceCIDR = defaultInstanceCIDR
+			}
+			if s.ZoneType != "" && !supportedZoneTypes[s.ZoneType] {
+				return fmt.Errorf("subnet %q: unsupported zoneType %q", s.AvailabilityZone, s.ZoneType)
+			}
+			if s.Edge() {
+				if s.ParentZone == "" {
+					return fmt.Errorf("subnet %q: parentZone must be specified for zoneType %q", s.AvailabilityZone, s.ZoneType)
+				}
+				if !parentZoneInRegion(s.ParentZone, c.Region) {
+					return fmt.Errorf("subnet %q: parentZone %q is not in region %q", s.AvailabilityZone, s.ParentZone, c.Region)
+				}
+			} else if s.ParentZone != "" {
+				return fmt.Errorf("subnet %q: parentZone is only valid for local-zone/wavelength-zone subnets", s.AvailabilityZone)
+			}
+			subnets = append(subnets, s)
+		}
+		c.Subnets = subnets
+	} else {
+		instanceCIDR := c.InstanceCIDR
+		if instanceCIDR == "" {
+			instanceCIDR = defaultInstanceCIDR
+		}
+		c.Subnets = []Subnet{
+			{
+				AvailabilityZone: c.AvailabilityZone,
+				InstanceCIDR:     instanceCIDR,
+			},
+		}
+	}
+
+	for _, s := range c.Subnets {
+		if s.Imported() && c.VPCID == "" {
+			return fmt.Errorf("subnet %q: subnetId can only be specified together with a top-level vpcId", s.SubnetID)
+		}
+	}
+
+	if c.InstanceCIDR == "" {
+		c.InstanceCIDR = c.Subnets[0].InstanceCIDR
+	}
+	if c.ControllerIP == "" {
+		c.ControllerIP = defaultControllerIP
+	}
+
+	return c.validateSubnetCIDRs()
+}
+
+// validateSubnetCIDRs checks that the final subnet list doesn't contain
+// overlapping instanceCIDRs, comparing only CIDRs of the same IP family
+// (an IPv4 range and an IPv6 range never "overlap" with each other).
+func (c *Cluster) validateSubnetCIDRs() error {
+	type indexedNet struct {
+		subnetIndex int
+		net         *net.IPNet
+	}
+	byFamily := map[string][]indexedNet{}
+
+	for i, s := range c.Subnets {
+		families, err := parseCIDRSlot("instanceCIDR", s.InstanceCIDR)
+		if err != nil {
+			return err
+		}
+		for fam, n := range families {
+			byFamily[fam] = append(byFamily[fam], indexedNet{i, n})
+		}
+	}
+
+	for _, nets := range byFamily {
+		for i := 0; i < len(nets); i++ {
+			for j := i + 1; j < len(nets); j++ {
+				if cidrsOverlap(nets[i].net, nets[j].net) {
+					return fmt.Errorf("subnet %q overlaps with subnet %q",
+						c.Subnets[nets[i].subnetIndex].InstanceCIDR,
+						c.Subnets[nets[j].subnetIndex].InstanceCIDR)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateNetworking validates vpcCIDR/instanceCIDR/podCIDR/serviceCIDR and
+// derives dnsServiceIP. Each of these fields may be a single CIDR/address,
+// or a comma-separated IPv4+IPv6 pair for dual-stack clusters. vpcCIDR,
+// podCIDR and serviceCIDR must all cover the same family (or pair of
+// families), as must dnsServiceIP and kubernetesServiceIP when set. An
+// instanceCIDR may cover only a subset of vpcCIDR's families, and
+// controllerIP only families some subnet's instanceCIDR covers.
+func (c *Cluster) validateNetworking() error {
+	vpcFamilies, err := parseCIDRSlot("vpcCIDR", c.VPCCIDR)
+	if err != nil {
+		return err
+	}
+	podFamilies, err := parseCIDRSlot("podCIDR", c.PodCIDR)
+	if err != nil {
+		return err
+	}
+	serviceFamilies, err := parseCIDRSlot("serviceCIDR", c.ServiceCIDR)
+	if err != nil {
+		return err
+	}
+
+	if !familiesMatch(vpcFamilies, podFamilies) || !familiesMatch(vpcFamilies, serviceFamilies) {
+		return fmt.Errorf("vpcCIDR, podCIDR and serviceCIDR must all be single-stack (same IP family) or all dual-stack (one IPv4 and one IPv6 CIDR each)")
+	}
+
+	for fam, vpcNet := range vpcFamilies {
+		if cidrsOverlap(vpcNet, podFamilies[fam]) {
+			return fmt.Errorf("vpcCIDR %s overlaps with podCIDR %s", vpcNet, podFamilies[fam])
+		}
+		if cidrsOverlap(vpcNet, serviceFamilies[fam]) {
+			return fmt.Errorf("vpcCIDR %s overlaps with serviceCIDR %s", vpcNet, serviceFamilies[fam])
+		}
+	}
+
+	if err := c.validateAdditionalNetworks(vpcFamilies, podFamilies, serviceFamilies); err != nil {
+		return err
+	}
+
+	for _, s := range c.Subnets {
+		instanceFamilies, err := parseCIDRSlot("instanceCIDR", s.InstanceCIDR)
+		if err != nil {
+			return err
+		}
+		for fam, instanceNet := range instanceFamilies {
+			vpcNet, ok := vpcFamilies[fam]
+			if !ok {
+				return fmt.Errorf("instanceCIDR %s specifies an IP family not present in vpcCIDR %q", instanceNet, c.VPCCIDR)
+			}
+			if !vpcNet.Contains(instanceNet.IP) {
+				return fmt.Errorf("instanceCIDR %s is not contained in vpcCIDR %s", instanceNet, vpcNet)
+			}
+		}
+	}
+
+	controllerIPs, err := parseIPSlot("controllerIP", c.ControllerIP)
+	if err != nil {
+		return err
+	}
+	hasKnownSubnetCIDR := false
+	for _, s := range c.Subnets {
+		if s.InstanceCIDR != "" {
+			hasKnownSubnetCIDR = true
+			break
+		}
+	}
+	// Imported subnets (subnetId) don't have a CIDR kube-aws knows about, so
+	// when every subnet is imported there's nothing to validate against.
+	if hasKnownSubnetCIDR {
+		for fam, ip := range controllerIPs {
+			var host *Subnet
+			for i, s := range c.Subnets {
+				instanceFamilies, _ := parseCIDRSlot("instanceCIDR", s.InstanceCIDR)
+				if instanceNet, ok := instanceFamilies[fam]; ok && instanceNet.Contains(ip) {
+					host = &c.Subnets[i]
+					break
+				}
+			}
+			if host == nil {
+				return fmt.Errorf("controllerIP %s is not contained in any subnet's instanceCIDR", ip)
+			}
+			if host.Edge() {
+				return fmt.Errorf("controllerIP %s falls in subnet %q, which is a %s subnet; controllers can only be scheduled onto regular availability-zone subnets", ip, host.AvailabilityZone, host.ZoneType)
+			}
+		}
+	}
+
+	dnsServiceIPs, err := c.resolveDNSServiceIPs(serviceFamilies)
+	if err != nil {
+		return err
+	}
+	kubernetesServiceIPs, err := c.resolveKubernetesServiceIPs(serviceFamilies)
+	if err != nil {
+		return err
+	}
+	for fam, serviceNet := range serviceFamilies {
+		dnsIP := dnsServiceIPs[fam]
+		if !serviceNet.Contains(dnsIP) {
+			return fmt.Errorf("dnsServiceIP %s is not contained in serviceCIDR %s", dnsIP, serviceNet)
+		}
+		kubernetesServiceIP := kubernetesServiceIPs[fam]
+		if !serviceNet.Contains(kubernetesServiceIP) {
+			return fmt.Errorf("kubernetesServiceIP %s is not contained in serviceCIDR %s", kubernetesServiceIP, serviceNet)
+		}
+		if dnsIP.Equal(kubernetesServiceIP) {
+			return fmt.Errorf("dnsServiceIP %s conflicts with kubernetesServiceIP %s", dnsIP, kubernetesServiceIP)
+		}
+	}
+	c.DNSServiceIP = joinFamilyIPs(dnsServiceIPs)
+	c.KubernetesServiceIP = joinFamilyIPs(kubernetesServiceIPs)
+
+	if c.RouteTableID != "" && c.VPCID == "" {
+		return fmt.Errorf("routeTableId can only be specified together with vpcId")
+	}
+
+	return nil
+}
+
+// validateAdditionalNetworks checks that none of c.AdditionalNetworkCIDRs
+// overlaps with vpcCIDR, podCIDR or serviceCIDR, comparing only CIDRs of the
+// same IP family. Every conflict is reported, not just the first, since a
+// reserved/peered range typically needs to be fixed independently of any
+// others it happens to also clash with.
+func (c *Cluster) validateAdditionalNetworks(vpcFamilies, podFamilies, serviceFamilies familyCIDRs) error {
+	if len(c.AdditionalNetworkCIDRs) == 0 {
+		return nil
+	}
+
+	named := []struct {
+		name     string
+		families familyCIDRs
+	}{
+		{"vpcCIDR", vpcFamilies},
+		{"podCIDR", podFamilies},
+		{"serviceCIDR", serviceFamilies},
+	}
+
+	var conflicts []string
+	for _, raw := range c.AdditionalNetworkCIDRs {
+		_, additionalNet, err := net.ParseCIDR(raw)
+		if err != nil {
+			return fmt.Errorf("invalid additionalNetworkCIDRs entry %q: %v", raw, err)
+		}
+		fam := ipFamily(additionalNet.IP)
+
+		for _, n := range named {
+			if ownNet, ok := n.families[fam]; ok && cidrsOverlap(ownNet, additionalNet) {
+				conflicts = append(conflicts, fmt.Sprintf("%s %s overlaps with additionalNetworkCIDRs entry %s", n.name, ownNet, additionalNet))
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%d conflict(s) with additionalNetworkCIDRs:\n%s", len(conflicts), strings.Join(conflicts, "\n"))
+	}
+	return nil
+}
+
+// resolveDNSServiceIPs returns the dnsServiceIP to use for each IP family in
+// serviceFamilies: the user-supplied value if dnsServiceIP was set, or
+// serviceCIDR's network address +10 (the same "first usable / +N"
+// convention incrementIP implements for kubernetesServiceIP) otherwise.
+func (c *Cluster) resolveDNSServiceIPs(serviceFamilies familyCIDRs) (familyIPs, error) {
+	if c.DNSServiceIP == "" {
+		result := familyIPs{}
+		for fam, serviceNet := range serviceFamilies {
+			ip := serviceNet.IP
+			for i := 0; i < 10; i++ {
+				ip = incrementIP(ip)
+			}
+			result[fam] = ip
+		}
+		return result, nil
+	}
+
+	dnsServiceIPs, err := parseIPSlot("dnsServiceIP", c.DNSServiceIP)
+	if err != nil {
+		return nil, err
+	}
+	if !familyIPsMatchCIDRs(dnsServiceIPs, serviceFamilies) {
+		return nil, fmt.Errorf("dnsServiceIP must specify one address per IP family used by serviceCIDR")
+	}
+	return dnsServiceIPs, nil
+}
+
+// resolveKubernetesServiceIPs returns the kubernetesServiceIP to use for each
+// IP family in serviceFamilies: the user-supplied override if
+// KubernetesServiceIP was set, or serviceCIDR's network address + 1 (the
+// conventional first usable address) otherwise.
+func (c *Cluster) resolveKubernetesServiceIPs(serviceFamilies familyCIDRs) (familyIPs, error) {
+	if c.KubernetesServiceIP == "" {
+		result := familyIPs{}
+		for fam, serviceNet := range serviceFamilies {
+			result[fam] = incrementIP(serviceNet.IP)
+		}
+		return result, nil
+	}
+
+	kubernetesServiceIPs, err := parseIPSlot("kubernetesServiceIP", c.KubernetesServiceIP)
+	if err != nil {
+		return nil, err
+	}
+	if !familyIPsMatchCIDRs(kubernetesServiceIPs, serviceFamilies) {
+		return nil, fmt.Errorf("kubernetesServiceIP must specify one address per IP family used by serviceCIDR")
+	}
+	return kubernetesServiceIPs, nil
+}
+
+func (c *Cluster) validateDNS(ttlModified bool) error {
+	if c.CreateRecordSet {
+		if c.HostedZoneName == "" {
+			return fmt.Errorf("hostedZone must not be blank when createRecordSet is true")
+		}
+		if c.RecordSetTTL <= 0 {
+			return fmt.Errorf("recordSetTTL must be a positive integer, got %d", c.RecordSetTTL)
+		}
+		if !c.dnsProvider.IsSubdomain(c.ExternalDNSName) {
+			return fmt.Errorf("externalDNSName %q is not a subdomain of the %s zone's DNS suffix %q", c.ExternalDNSName, c.dnsProvider.Name(), c.dnsProvider.DNSSuffix())
+		}
+	} else if ttlModified {
+		return fmt.Errorf("recordSetTTL must not be modified when createRecordSet is false")
+	}
+
+	return nil
+}
+
+// cidrsOverlap reports whether a and b share any address, in either
+// direction of containment.
+func cidrsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// familyCIDRs maps an IP family ("4" or "6") to the single CIDR a
+// comma-separated config value specified for that family.
+type familyCIDRs map[string]*net.IPNet
+
+// familyIPs is the address equivalent of familyCIDRs.
+type familyIPs map[string]net.IP
+
+// ipFamily returns "4" or "6" depending on whether ip is an IPv4 or IPv6
+// address.
+func ipFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return "4"
+	}
+	return "6"
+}
+
+// splitCommaList splits a comma-separated config value into its trimmed,
+// non-empty parts. A single-stack value yields one part; a dual-stack
+// value (e.g. "10.6.0.0/16,fd00:10:6::/64") yields two.
+func splitCommaList(raw string) []string {
+	var parts []string
+	for _, p := range strings.Split(raw, ",") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// parseCIDRSlot parses a single-stack or dual-stack CIDR config value,
+// keyed by IP family. It is an error for both parts of a dual-stack value
+// to share a family.
+func parseCIDRSlot(name, raw string) (familyCIDRs, error) {
+	result := familyCIDRs{}
+	for _, p := range splitCommaList(raw) {
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", name, p, err)
+		}
+		fam := ipFamily(n.IP)
+		if _, exists := result[fam]; exists {
+			return nil, fmt.Errorf("%s %q specifies more than one IPv%s CIDR", name, raw, fam)
+		}
+		result[fam] = n
+	}
+	return result, nil
+}
+
+// parseIPSlot is the address equivalent of parseCIDRSlot, used for
+// controllerIP and dnsServiceIP.
+func parseIPSlot(name, raw string) (familyIPs, error) {
+	result := familyIPs{}
+	for _, p := range splitCommaList(raw) {
+		ip := net.ParseIP(p)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid %s %q", name, p)
+		}
+		fam := ipFamily(ip)
+		if _, exists := result[fam]; exists {
+			return nil, fmt.Errorf("%s %q specifies more than one IPv%s address", name, raw, fam)
+		}
+		result[fam] = ip
+	}
+	return result, nil
+}
+
+// familiesMatch reports whether a and b specify CIDRs for exactly the same
+// set of IP families.
+func familiesMatch(a, b familyCIDRs) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for fam := range a {
+		if _, ok := b[fam]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// familyIPsMatchCIDRs reports whether ips has exactly one address for each
+// IP family present in cidrs.
+func familyIPsMatchCIDRs(ips familyIPs, cidrs familyCIDRs) bool {
+	if len(ips) != len(cidrs) {
+		return false
+	}
+	for fam := range ips {
+		if _, ok := cidrs[fam]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// joinFamilyIPs renders a familyIPs map back into the comma-separated,
+// IPv4-then-IPv6 config format.
+func joinFamilyIPs(ips familyIPs) string {
+	var parts []string
+	for _, fam := range []string{"4", "6"} {
+		if ip, ok := ips[fam]; ok {
+			parts = append(parts, ip.String())
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// incrementIP returns the address immediately following ip. It operates on
+// the 4-byte or 16-byte form of ip, so it works the same way for IPv4 and
+// IPv6 addresses.
+func incrementIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// parentZoneInRegion reports whether parentZone is an availability zone (or
+// Local Zone / Wavelength Zone name) belonging to region. AWS zone names are
+// formed by appending a suffix to their region's name, so a prefix match
+// alone is not enough: region "us-west-1" must not also match "us-west-10a",
+// since the region there is actually "us-west-10". We additionally require
+// the byte right after the region prefix to not be a digit, since every AWS
+// region name ends in one and every valid zone suffix (the AZ letter, or the
+// leading "-" of an edge zone's suffix) does not.
+func parentZoneInRegion(parentZone, region string) bool {
+	if !strings.HasPrefix(parentZone, region) {
+		return false
+	}
+	suffix := parentZone[len(region):]
+	if suffix == "" {
+		return false
+	}
+	return suffix[0] < '0' || suffix[0] > '9'
+}
+
+// isSubdomain reports whether sub is parent or a subdomain of parent,
+// ignoring any trailing dots on either name.
+func isSubdomain(sub, parent string) bool {
+	sub = strings.TrimSuffix(sub, ".")
+	parent = strings.TrimSuffix(parent, ".")
+
+	if len(sub) < len(parent) {
+		return false
+	}
+	if len(sub) == len(parent) {
+		return sub == parent
+	}
+
+	return strings.HasSuffix(sub, "."+parent)
+}
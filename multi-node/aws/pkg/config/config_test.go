@@ -3,6 +3,7 @@ package config
 import (
 	"net"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -50,6 +51,66 @@ hostedZone: core-os.net
 `, `
 createRecordSet: true
 hostedZone: "staging.core-os.net"
+`, `
+vpcCIDR: 10.4.0.0/16
+instanceCIDR: 10.4.3.0/24
+controllerIP: 10.4.3.5
+podCIDR: 10.6.0.0/16
+serviceCIDR: 10.5.0.0/16
+dnsServiceIP: 10.5.100.101
+additionalNetworkCIDRs:
+- 192.168.0.0/16
+- 172.16.0.0/12
+`,
+}
+
+var goodDualStackNetworkingConfigs = []string{
+	`
+vpcCIDR: 10.4.0.0/16,fd00:10:4::/48
+instanceCIDR: 10.4.3.0/24,fd00:10:4:3::/64
+controllerIP: 10.4.3.5,fd00:10:4:3::5
+podCIDR: 10.6.0.0/16,fd00:10:6::/64
+serviceCIDR: 10.5.0.0/16,fd00:10:5::/64
+dnsServiceIP: 10.5.100.101,fd00:10:5::101
+`,
+}
+
+var incorrectDualStackNetworkingConfigs = []string{
+	`
+# podCIDR is dual-stack but vpcCIDR/serviceCIDR are IPv4-only
+vpcCIDR: 10.4.0.0/16
+instanceCIDR: 10.4.3.0/24
+controllerIP: 10.4.3.5
+podCIDR: 10.6.0.0/16,fd00:10:6::/64
+serviceCIDR: 10.5.0.0/16
+dnsServiceIP: 10.5.100.101
+`, `
+# dnsServiceIP only specifies the IPv4 half of a dual-stack serviceCIDR
+vpcCIDR: 10.4.0.0/16,fd00:10:4::/48
+instanceCIDR: 10.4.3.0/24,fd00:10:4:3::/64
+controllerIP: 10.4.3.5,fd00:10:4:3::5
+podCIDR: 10.6.0.0/16,fd00:10:6::/64
+serviceCIDR: 10.5.0.0/16,fd00:10:5::/64
+dnsServiceIP: 10.5.100.101
+`, `
+# vpcCIDR (IPv6 half) overlaps with podCIDR (IPv6 half)
+vpcCIDR: 10.4.0.0/16,fd00:10:6::/48
+instanceCIDR: 10.4.3.0/24,fd00:10:6:3::/64
+controllerIP: 10.4.3.5,fd00:10:6:3::5
+podCIDR: 10.6.0.0/16,fd00:10:6::/64
+serviceCIDR: 10.5.0.0/16,fd00:10:5::/64
+dnsServiceIP: 10.5.100.101,fd00:10:5::101
+`, `
+# additionalNetworkCIDRs entry overlaps with podCIDR's IPv6 half only; the
+# IPv4 half must not mask the conflict in the other family.
+vpcCIDR: 10.4.0.0/16,fd00:10:4::/48
+instanceCIDR: 10.4.3.0/24,fd00:10:4:3::/64
+controllerIP: 10.4.3.5,fd00:10:4:3::5
+podCIDR: 10.6.0.0/16,fd00:10:6::/64
+serviceCIDR: 10.5.0.0/16,fd00:10:5::/64
+dnsServiceIP: 10.5.100.101,fd00:10:5::101
+additionalNetworkCIDRs:
+- fd00:10:6::/56
 `,
 }
 
@@ -115,6 +176,52 @@ recordSetTTL: 400
 # whatever.com is not a superdomain of test.staging.core-os.net
 createRecordSet: true
 hostedZone: "whatever.com"
+`, `
+# podCIDR overlaps with an additionalNetworkCIDRs entry
+vpcCIDR: 10.4.0.0/16
+instanceCIDR: 10.4.3.0/24
+controllerIP: 10.4.3.5
+podCIDR: 10.6.0.0/16
+serviceCIDR: 10.5.0.0/16
+dnsServiceIP: 10.5.100.101
+additionalNetworkCIDRs:
+- 10.6.1.0/24
+`, `
+# serviceCIDR overlaps with an additionalNetworkCIDRs entry
+vpcCIDR: 10.4.0.0/16
+instanceCIDR: 10.4.3.0/24
+controllerIP: 10.4.3.5
+podCIDR: 10.6.0.0/16
+serviceCIDR: 10.5.0.0/16
+dnsServiceIP: 10.5.100.101
+additionalNetworkCIDRs:
+- 10.0.0.0/8
+`, `
+# vpcCIDR overlaps with a peered additionalNetworkCIDRs entry
+vpcCIDR: 10.4.0.0/16
+instanceCIDR: 10.4.3.0/24
+controllerIP: 10.4.3.5
+podCIDR: 172.4.0.0/16
+serviceCIDR: 172.5.0.0/16
+dnsServiceIP: 172.5.100.101
+additionalNetworkCIDRs:
+- 10.4.128.0/20
+`, `
+vpcCIDR: 10.4.3.0/16
+instanceCIDR: 10.4.3.0/24
+controllerIP: 10.4.3.5
+podCIDR: 172.4.0.0/16
+serviceCIDR: 172.5.0.0/16
+dnsServiceIP: 172.5.100.101
+kubernetesServiceIP: 172.6.0.1 #kubernetesServiceIP not in serviceCIDR
+`, `
+vpcCIDR: 10.4.3.0/16
+instanceCIDR: 10.4.3.0/24
+controllerIP: 10.4.3.5
+podCIDR: 172.4.0.0/16
+serviceCIDR: 172.5.0.0/16
+dnsServiceIP: 172.5.100.101
+kubernetesServiceIP: 172.5.100.101 #kubernetesServiceIP conflicts with dnsServiceIP
 `,
 }
 
@@ -127,6 +234,13 @@ func TestNetworkValidation(t *testing.T) {
 		}
 	}
 
+	for _, networkConfig := range goodDualStackNetworkingConfigs {
+		configBody := singleAzConfigYaml + networkConfig
+		if _, err := ClusterFromBytes([]byte(configBody)); err != nil {
+			t.Errorf("Correct dual-stack config tested invalid: %s\n%s", err, networkConfig)
+		}
+	}
+
 	for _, networkConfig := range incorrectNetworkingConfigs {
 		configBody := singleAzConfigYaml + networkConfig
 		if _, err := ClusterFromBytes([]byte(configBody)); err == nil {
@@ -134,6 +248,13 @@ func TestNetworkValidation(t *testing.T) {
 		}
 	}
 
+	for _, networkConfig := range incorrectDualStackNetworkingConfigs {
+		configBody := singleAzConfigYaml + networkConfig
+		if _, err := ClusterFromBytes([]byte(configBody)); err == nil {
+			t.Errorf("Incorrect dual-stack config tested valid, expected error:\n%s", networkConfig)
+		}
+	}
+
 }
 
 func TestKubernetesServiceIPInference(t *testing.T) {
@@ -172,6 +293,16 @@ dnsServiceIP: 10.6.142.100
         `,
 			KubernetesServiceIP: "10.6.142.97",
 		},
+		{
+			// kubernetesServiceIP is an explicit override rather than the
+			// inferred "network address + 1".
+			NetworkConfig: `
+serviceCIDR: 10.6.140.0/24
+dnsServiceIP: 10.6.140.50
+kubernetesServiceIP: 10.6.140.80
+        `,
+			KubernetesServiceIP: "10.6.140.80",
+		},
 	}
 
 	for _, testConfig := range testConfigs {
@@ -182,17 +313,70 @@ dnsServiceIP: 10.6.142.100
 			continue
 		}
 
-		_, serviceNet, err := net.ParseCIDR(cluster.ServiceCIDR)
+		if cluster.KubernetesServiceIP != testConfig.KubernetesServiceIP {
+			t.Errorf("KubernetesServiceIP mismatch: got %s, expected %s",
+				cluster.KubernetesServiceIP,
+				testConfig.KubernetesServiceIP)
+		}
+	}
+
+}
+
+func TestKubernetesServiceIPInferenceIPv6(t *testing.T) {
+
+	// Dual-stack serviceCIDRs derive one kubernetesServiceIP per IP family,
+	// using the same "network address + 1" convention as the IPv4 case.
+	testConfigs := []struct {
+		NetworkConfig        string
+		KubernetesServiceIPs []string
+	}{
+		{
+			NetworkConfig: `
+vpcCIDR: 10.4.0.0/16,fd00:10:4::/48
+instanceCIDR: 10.4.3.0/24,fd00:10:4:3::/64
+controllerIP: 10.4.3.5,fd00:10:4:3::5
+podCIDR: 10.6.0.0/16,fd00:10:6::/64
+serviceCIDR: 172.5.10.10/22,fd00:172:5::/64
+dnsServiceIP: 172.5.8.101,fd00:172:5::101
+        `,
+			KubernetesServiceIPs: []string{"172.5.8.1", "fd00:172:5::1"},
+		},
+	}
+
+	for _, testConfig := range testConfigs {
+		configBody := singleAzConfigYaml + testConfig.NetworkConfig
+		cluster, err := ClusterFromBytes([]byte(configBody))
 		if err != nil {
-			t.Errorf("invalid serviceCIDR: %v", err)
+			t.Errorf("Unexpected error parsing config: %v\n %s", err, configBody)
 			continue
 		}
 
-		kubernetesServiceIP := incrementIP(serviceNet.IP)
-		if kubernetesServiceIP.String() != testConfig.KubernetesServiceIP {
-			t.Errorf("KubernetesServiceIP mismatch: got %s, expected %s",
-				kubernetesServiceIP,
-				testConfig.KubernetesServiceIP)
+		derivedIPs := strings.Split(cluster.KubernetesServiceIP, ",")
+		for _, cidr := range strings.Split(cluster.ServiceCIDR, ",") {
+			_, serviceNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				t.Errorf("invalid serviceCIDR: %v", err)
+				continue
+			}
+
+			// The derived address for this serviceCIDR's IP family.
+			kubernetesServiceIP := ""
+			for _, ip := range derivedIPs {
+				if serviceNet.Contains(net.ParseIP(ip)) {
+					kubernetesServiceIP = ip
+					break
+				}
+			}
+			found := false
+			for _, expected := range testConfig.KubernetesServiceIPs {
+				if expected == kubernetesServiceIP {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Errorf("KubernetesServiceIP %s not among expected values %v", kubernetesServiceIP, testConfig.KubernetesServiceIPs)
+			}
 		}
 	}
 
@@ -260,6 +444,139 @@ func TestIsSubdomain(t *testing.T) {
 
 }
 
+func TestDNSProviderSelection(t *testing.T) {
+
+	validConfigs := []struct {
+		conf         string
+		providerName string
+		dnsSuffix    string
+	}{
+		{
+			// dnsProvider defaults to route53
+			conf: `
+createRecordSet: true
+hostedZone: core-os.net
+`,
+			providerName: "route53",
+			dnsSuffix:    "core-os.net",
+		},
+		{
+			conf: `
+dnsProvider: route53
+createRecordSet: true
+hostedZone: core-os.net
+`,
+			providerName: "route53",
+			dnsSuffix:    "core-os.net",
+		},
+		{
+			// GCP managed-zone names needn't match the DNS suffix they serve
+			conf: `
+dnsProvider: gcp
+createRecordSet: true
+hostedZoneName: staging-core-os-net
+hostedZoneDNSSuffix: staging.core-os.net
+`,
+			providerName: "gcp",
+			dnsSuffix:    "staging.core-os.net",
+		},
+	}
+
+	for _, conf := range validConfigs {
+		confBody := singleAzConfigYaml + conf.conf
+		c, err := ClusterFromBytes([]byte(confBody))
+		if err != nil {
+			t.Errorf("failed to parse config %s: %v", confBody, err)
+			continue
+		}
+		if c.DNSProvider().Name() != conf.providerName {
+			t.Errorf("expected dnsProvider %q, got %q", conf.providerName, c.DNSProvider().Name())
+		}
+		if c.DNSProvider().DNSSuffix() != conf.dnsSuffix {
+			t.Errorf("expected DNS suffix %q, got %q", conf.dnsSuffix, c.DNSProvider().DNSSuffix())
+		}
+	}
+
+	invalidConfigs := []string{
+		`
+# unsupported dnsProvider
+dnsProvider: route54
+`, `
+# route53 zones are always named after the suffix they serve
+dnsProvider: route53
+createRecordSet: true
+hostedZoneName: core-os.net
+hostedZoneDNSSuffix: staging.core-os.net
+`, `
+# externalDNSName is not a subdomain of hostedZoneDNSSuffix
+dnsProvider: gcp
+createRecordSet: true
+hostedZoneName: staging-core-os-net
+hostedZoneDNSSuffix: whatever.com
+`,
+	}
+
+	for _, conf := range invalidConfigs {
+		confBody := singleAzConfigYaml + conf
+		if _, err := ClusterFromBytes([]byte(confBody)); err == nil {
+			t.Errorf("expected error parsing invalid config: %s", confBody)
+		}
+	}
+
+}
+
+// TestFakeDNSProvider exercises the DNSProvider interface directly through
+// fakeDNSProvider, independent of the dnsProvider config key dispatch
+// TestDNSProviderSelection covers.
+func TestFakeDNSProvider(t *testing.T) {
+	var provider DNSProvider = &fakeDNSProvider{
+		name:      "fake",
+		zoneName:  "fake-zone",
+		dnsSuffix: "example.com",
+	}
+
+	if provider.Name() != "fake" {
+		t.Errorf("Name() = %q, want %q", provider.Name(), "fake")
+	}
+	if provider.HostedZoneName() != "fake-zone" {
+		t.Errorf("HostedZoneName() = %q, want %q", provider.HostedZoneName(), "fake-zone")
+	}
+	if provider.DNSSuffix() != "example.com" {
+		t.Errorf("DNSSuffix() = %q, want %q", provider.DNSSuffix(), "example.com")
+	}
+	if !provider.IsSubdomain("foo.example.com") {
+		t.Errorf("IsSubdomain(foo.example.com) = false, want true")
+	}
+	if provider.IsSubdomain("foo.other.com") {
+		t.Errorf("IsSubdomain(foo.other.com) = true, want false")
+	}
+}
+
+func TestServiceDNSDomain(t *testing.T) {
+
+	// With no serviceDNSDomain given, the parsed value is the standard
+	// "cluster.local" default. Only the parsed Cluster field is checked here.
+	cluster, err := ClusterFromBytes([]byte(singleAzConfigYaml))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing config: %v", err)
+	}
+	if cluster.ServiceDNSDomain != defaultServiceDNSDomain {
+		t.Errorf("expected default serviceDNSDomain %q, got %q", defaultServiceDNSDomain, cluster.ServiceDNSDomain)
+	}
+
+	confBody := singleAzConfigYaml + `
+serviceDNSDomain: svc.example.internal
+`
+	cluster, err = ClusterFromBytes([]byte(confBody))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing config: %v", err)
+	}
+	if cluster.ServiceDNSDomain != "svc.example.internal" {
+		t.Errorf("expected serviceDNSDomain %q, got %q", "svc.example.internal", cluster.ServiceDNSDomain)
+	}
+
+}
+
 func TestReleaseChannel(t *testing.T) {
 
 	validConfigs := []struct {
@@ -400,6 +717,77 @@ availabilityZone: "ap-northeast-1a"
 				},
 			},
 		},
+		{
+			conf: `
+# All subnets can be imported from a pre-existing VPC by subnetId
+vpcId: vpc-abcdefab
+subnets:
+  - availabilityZone: ap-northeast-1a
+    subnetId: subnet-aaaaaaaa
+  - availabilityZone: ap-northeast-1c
+    subnetId: subnet-cccccccc
+`,
+			subnets: []Subnet{
+				{
+					AvailabilityZone: "ap-northeast-1a",
+					SubnetID:         "subnet-aaaaaaaa",
+				},
+				{
+					AvailabilityZone: "ap-northeast-1c",
+					SubnetID:         "subnet-cccccccc",
+				},
+			},
+		},
+		{
+			conf: `
+# Imported and kube-aws-created subnets can be mixed
+vpcId: vpc-abcdefab
+vpcCIDR: 10.4.0.0/16
+controllerIP: 10.4.4.50
+subnets:
+  - availabilityZone: ap-northeast-1a
+    subnetId: subnet-aaaaaaaa
+  - availabilityZone: ap-northeast-1c
+    instanceCIDR: 10.4.4.0/24
+`,
+			subnets: []Subnet{
+				{
+					AvailabilityZone: "ap-northeast-1a",
+					SubnetID:         "subnet-aaaaaaaa",
+				},
+				{
+					AvailabilityZone: "ap-northeast-1c",
+					InstanceCIDR:     "10.4.4.0/24",
+				},
+			},
+		},
+		{
+			conf: `
+# A Local Zone subnet can be mixed in alongside a regular availability-zone
+# one, as long as nothing control-plane-related is scheduled onto it.
+vpcCIDR: 10.4.0.0/16
+controllerIP: 10.4.3.50
+subnets:
+  - availabilityZone: us-west-1a
+    instanceCIDR: 10.4.3.0/24
+  - availabilityZone: us-west-1-lax-1a
+    instanceCIDR: 10.4.4.0/24
+    zoneType: local-zone
+    parentZone: us-west-1a
+`,
+			subnets: []Subnet{
+				{
+					AvailabilityZone: "us-west-1a",
+					InstanceCIDR:     "10.4.3.0/24",
+				},
+				{
+					AvailabilityZone: "us-west-1-lax-1a",
+					InstanceCIDR:     "10.4.4.0/24",
+					ZoneType:         "local-zone",
+					ParentZone:       "us-west-1a",
+				},
+			},
+		},
 	}
 
 	invalidConfigs := []string{
@@ -445,6 +833,59 @@ subnets:
   instanceCIDR: 10.0.5.0/24
 - availabilityZone: "ap-northeast-1b"
   instanceCIDR: 10.0.5.0/24
+`,
+		`
+# subnetId requires a top-level vpcId
+subnets:
+- availabilityZone: "ap-northeast-1a"
+  subnetId: subnet-aaaaaaaa
+`,
+		`
+# subnetId and instanceCIDR on the same subnet are ambiguous
+vpcId: vpc-abcdefab
+subnets:
+- availabilityZone: "ap-northeast-1a"
+  subnetId: subnet-aaaaaaaa
+  instanceCIDR: 10.0.0.0/24
+`,
+		`
+# zoneType must be one of the supported values
+subnets:
+- availabilityZone: "us-west-1a"
+  instanceCIDR: 10.0.0.0/24
+  zoneType: edge-zone
+`,
+		`
+# local-zone/wavelength-zone subnets require a parentZone
+subnets:
+- availabilityZone: "us-west-1-lax-1a"
+  instanceCIDR: 10.0.0.0/24
+  zoneType: local-zone
+`,
+		`
+# parentZone must be in the cluster's region (us-west-1)
+subnets:
+- availabilityZone: "us-west-1-lax-1a"
+  instanceCIDR: 10.0.0.0/24
+  zoneType: local-zone
+  parentZone: us-east-1a
+`,
+		`
+# parentZone us-west-10a is region us-west-10, not us-west-1: a region
+# prefix match alone must not be treated as "same region"
+subnets:
+- availabilityZone: "us-west-1-lax-1a"
+  instanceCIDR: 10.0.0.0/24
+  zoneType: local-zone
+  parentZone: us-west-10a
+`,
+		`
+# controllers can't be scheduled onto a Wavelength Zone subnet
+subnets:
+- availabilityZone: "us-west-1-wl1-a"
+  instanceCIDR: 10.0.0.0/24
+  zoneType: wavelength-zone
+  parentZone: us-west-1a
 `,
 	}
 
@@ -0,0 +1,98 @@
+package config
+
+import "fmt"
+
+const (
+	dnsProviderRoute53 = "route53"
+	dnsProviderGCP     = "gcp"
+
+	defaultDNSProvider = dnsProviderRoute53
+)
+
+// DNSProvider describes the DNS zone (Route53, or Google Cloud DNS) that
+// holds externalDNSName's record set, and performs the subdomain check
+// against that zone. It identifies the zone only; it has no method that
+// creates records.
+type DNSProvider interface {
+	// Name identifies the provider, as given to the dnsProvider config key.
+	Name() string
+	// HostedZoneName is the identifier kube-aws uses to locate the zone
+	// with the provider (a Route53 zone name, or a Google Cloud DNS
+	// managed-zone name).
+	HostedZoneName() string
+	// DNSSuffix is the actual DNS suffix the zone manages. For Route53
+	// this is always equal to HostedZoneName; Google Cloud DNS managed
+	// zones are named independently of the suffix they serve, so the two
+	// can differ there.
+	DNSSuffix() string
+	// IsSubdomain reports whether externalDNSName is the zone's DNS
+	// suffix, or a subdomain of it.
+	IsSubdomain(externalDNSName string) bool
+}
+
+// route53DNSProvider is the default DNSProvider: Route53 hosted zones are
+// named after the DNS suffix they serve, so HostedZoneName and DNSSuffix
+// are the same value.
+type route53DNSProvider struct {
+	zoneName string
+}
+
+func (p *route53DNSProvider) Name() string           { return dnsProviderRoute53 }
+func (p *route53DNSProvider) HostedZoneName() string { return p.zoneName }
+func (p *route53DNSProvider) DNSSuffix() string      { return p.zoneName }
+func (p *route53DNSProvider) IsSubdomain(name string) bool {
+	return isSubdomain(name, p.zoneName)
+}
+
+// googleCloudDNSProvider supports Google Cloud DNS managed zones, whose
+// resource name (e.g. "my-zone") need not match the DNS suffix they
+// actually serve (e.g. "staging.example.com.").
+type googleCloudDNSProvider struct {
+	zoneName  string
+	dnsSuffix string
+}
+
+func (p *googleCloudDNSProvider) Name() string           { return dnsProviderGCP }
+func (p *googleCloudDNSProvider) HostedZoneName() string { return p.zoneName }
+func (p *googleCloudDNSProvider) DNSSuffix() string      { return p.dnsSuffix }
+func (p *googleCloudDNSProvider) IsSubdomain(name string) bool {
+	return isSubdomain(name, p.dnsSuffix)
+}
+
+// fakeDNSProvider lets tests use the DNSProvider interface directly, with
+// a name, zone name and suffix set independently of each other. It is not
+// selectable through dnsProvider: newDNSProvider never returns it.
+type fakeDNSProvider struct {
+	name      string
+	zoneName  string
+	dnsSuffix string
+}
+
+func (p *fakeDNSProvider) Name() string           { return p.name }
+func (p *fakeDNSProvider) HostedZoneName() string { return p.zoneName }
+func (p *fakeDNSProvider) DNSSuffix() string      { return p.dnsSuffix }
+func (p *fakeDNSProvider) IsSubdomain(name string) bool {
+	return isSubdomain(name, p.dnsSuffix)
+}
+
+// newDNSProvider constructs the DNSProvider named by providerName.
+// hostedZoneName is the Route53/GCP zone identifier; hostedZoneDNSSuffix
+// overrides the DNS suffix used for the subdomain check when it differs
+// from hostedZoneName (Route53 zones never need this).
+func newDNSProvider(providerName, hostedZoneName, hostedZoneDNSSuffix string) (DNSProvider, error) {
+	switch providerName {
+	case dnsProviderRoute53:
+		if hostedZoneDNSSuffix != "" && hostedZoneDNSSuffix != hostedZoneName {
+			return nil, fmt.Errorf("hostedZoneDNSSuffix can only differ from hostedZoneName when dnsProvider is %q", dnsProviderGCP)
+		}
+		return &route53DNSProvider{zoneName: hostedZoneName}, nil
+	case dnsProviderGCP:
+		suffix := hostedZoneDNSSuffix
+		if suffix == "" {
+			suffix = hostedZoneName
+		}
+		return &googleCloudDNSProvider{zoneName: hostedZoneName, dnsSuffix: suffix}, nil
+	default:
+		return nil, fmt.Errorf("dnsProvider %q is not supported", providerName)
+	}
+}